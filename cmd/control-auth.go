@@ -0,0 +1,261 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+)
+
+// capability - a single scoped permission baked into a control JWT's
+// "scope" claim, e.g. "heal:read" or "service:restart". "admin:*" grants
+// every capability.
+type capability string
+
+const (
+	capHealRead       capability = "heal:read"
+	capHealWrite      capability = "heal:write"
+	capServiceRestart capability = "service:restart"
+	capServiceStop    capability = "service:stop"
+	capAdminAll       capability = "admin:*"
+)
+
+// defaultLoginCapabilities - capabilities minted into every token
+// LoginHandler issues. There is no per-user entitlement model yet, so a
+// successful username/password login still grants full access; scoping to
+// individual users is a follow-up now that the enforcement path exists.
+var defaultLoginCapabilities = []capability{capAdminAll}
+
+// errCapabilityDenied - the token presented does not carry the capability a
+// handler requires.
+var errCapabilityDenied = errors.New("Token does not grant the required capability.")
+
+// errTokenRevoked - the token presented has been explicitly revoked.
+var errTokenRevoked = errors.New("Token has been revoked.")
+
+// handlerCapabilities maps each control RPC method name to the capability a
+// caller must present to invoke it. Kept centralized so a new handler can't
+// accidentally ship without an entry here. ServiceHandler is special-cased
+// in isRPCTokenAuthorized since stop needs a strictly narrower grant than
+// restart.
+var handlerCapabilities = map[string]capability{
+	"Control.ListObjectsHealHandler":     capHealRead,
+	"Control.HealStatusHandler":          capHealRead,
+	"Control.HealSchedulerStatusHandler": capHealRead,
+	"Control.HealObjectHandler":          capHealWrite,
+	"Control.HealBucketHandler":          capHealWrite,
+	"Control.HealCancelHandler":          capHealWrite,
+	"Control.HealDiskMetadataHandler":    capHealWrite,
+	"Control.TryInitHandler":             capHealWrite,
+	"Control.ServiceHandler":             capServiceRestart,
+	"Control.RevokeTokenHandler":         capAdminAll,
+}
+
+// jwtClaims is the subset of a control JWT's claims this package cares
+// about. The token's signature has already been verified by
+// isRPCTokenValid by the time anything here reads it; parseJWTClaims only
+// ever decodes, it never re-verifies.
+type jwtClaims struct {
+	// JTI is the JWT ID, used as the denylist key on revocation so the raw
+	// token is never itself persisted anywhere.
+	JTI string `json:"jti"`
+
+	// Scope lists the capabilities this token grants.
+	Scope []capability `json:"scope"`
+}
+
+// parseJWTClaims decodes (without re-verifying) the claims segment of an
+// already-authenticated control JWT.
+func parseJWTClaims(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	claims := &jwtClaims{}
+	if err = json.Unmarshal(payload, claims); err != nil {
+		return nil, errInvalidToken
+	}
+	return claims, nil
+}
+
+// hasCapability reports whether granted contains want or the blanket
+// "admin:*" capability.
+func hasCapability(granted []capability, want capability) bool {
+	for _, g := range granted {
+		if g == capAdminAll || g == want {
+			return true
+		}
+	}
+	return false
+}
+
+// isRPCTokenAuthorized validates token the same way isRPCTokenValid does,
+// additionally checking it against the revocation denylist and requiring it
+// carry the capability method needs. signal narrows ServiceHandler's
+// requirement to capServiceStop when the caller is asking for a stop,
+// since stop is a strictly more dangerous capability than restart.
+func isRPCTokenAuthorized(token, method string, signal serviceSignal) error {
+	if !isRPCTokenValid(token) {
+		return errInvalidToken
+	}
+	if globalTokenDenylist.isRevoked(token) {
+		return errTokenRevoked
+	}
+	claims, err := parseJWTClaims(token)
+	if err != nil {
+		return err
+	}
+	want, ok := handlerCapabilities[method]
+	if !ok {
+		return errCapabilityDenied
+	}
+	if method == "Control.ServiceHandler" && signal == serviceStop {
+		want = capServiceStop
+	}
+	if !hasCapability(claims.Scope, want) {
+		return errCapabilityDenied
+	}
+	return nil
+}
+
+// tokenDenylist is a small, peer-replicated set of revoked token IDs so a
+// leaked capability-scoped token can be killed cluster-wide without
+// restarting every node. Entries are keyed by the token's JWT ID (jti)
+// rather than the raw token so the denylist never itself becomes a place
+// secrets are stored at rest.
+type tokenDenylist struct {
+	mu      sync.RWMutex
+	revoked map[string]bool
+}
+
+// globalTokenDenylist - process wide revoked-token set, replicated to peers
+// by RevokeTokenHandler.
+var globalTokenDenylist = &tokenDenylist{
+	revoked: make(map[string]bool),
+}
+
+// isRevoked reports whether token's jti is on the denylist. A malformed
+// token is rejected earlier by isRPCTokenValid, so a parse failure here
+// just means "not on this list", not "revoked".
+func (d *tokenDenylist) isRevoked(token string) bool {
+	claims, err := parseJWTClaims(token)
+	if err != nil {
+		return false
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.revoked[claims.JTI]
+}
+
+// revoke adds jti to the local denylist.
+func (d *tokenDenylist) revoke(jti string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.revoked[jti] = true
+}
+
+// RevokeTokenArgs - argument for the RevokeToken RPC.
+type RevokeTokenArgs struct {
+	// Authentication token generated by Login, must itself carry admin:*.
+	GenericArgs
+
+	// JTI is the JWT ID (the "jti" claim) of the token to revoke, so the
+	// revocation request never carries the revoked token itself.
+	JTI string
+}
+
+// RevokeToken - revokes a previously issued token cluster-wide by adding its
+// JTI to every peer's denylist. Only a caller holding admin:* may revoke, to
+// keep a scoped token from escalating by revoking someone else's.
+func (c *controlAPIHandlers) RevokeTokenHandler(args *RevokeTokenArgs, reply *GenericReply) error {
+	if err := isRPCTokenAuthorized(args.Token, "Control.RevokeTokenHandler", 0); err != nil {
+		return err
+	}
+	globalTokenDenylist.revoke(args.JTI)
+
+	if !args.Remote {
+		ctx, cancel := context.WithTimeout(context.Background(), peerBroadcastTimeout)
+		defer cancel()
+		results := peerBroadcast(ctx, c.RemoteControls, "Control.RevokeTokenHandler",
+			func(i int) interface{} {
+				return &RevokeTokenArgs{GenericArgs: GenericArgs{Token: args.Token, Remote: true}, JTI: args.JTI}
+			},
+			func() interface{} { return &GenericReply{} })
+		for _, r := range results {
+			if r.Err != nil {
+				errorIf(r.Err, "Peer %s failed to replicate token revocation", r.Node)
+			}
+		}
+	}
+	return nil
+}
+
+// controlMTLSConfig toggles optional mutual-TLS authentication between
+// control-plane peers. Unset (the zero value) means plain TCP, matching
+// today's behavior.
+type controlMTLSConfig struct {
+	Enabled   bool
+	NodeCert  tls.Certificate
+	ClusterCA *x509.CertPool
+}
+
+// globalControlMTLSConfig - process wide mTLS settings for control RPC peer
+// connections, intended to be populated from server config at startup and
+// consumed by dialControlPeer. Nothing dials through dialControlPeer yet
+// (see its doc comment), so this is not currently enforced anywhere.
+var globalControlMTLSConfig controlMTLSConfig
+
+// controlPeerTLSConfig builds the *tls.Config used for inter-node control
+// RPCs when mTLS is enabled: every peer must present a certificate signed by
+// the cluster CA, and this node authenticates itself with its own node
+// certificate.
+func controlPeerTLSConfig(nodeCert tls.Certificate, clusterCA *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{nodeCert},
+		RootCAs:      clusterCA,
+		ClientCAs:    clusterCA,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// dialControlPeer dials a control-plane peer: mTLS via controlPeerTLSConfig
+// when globalControlMTLSConfig is enabled, a plain TCP connection otherwise.
+//
+// Nothing calls this yet - RemoteControls' AuthRPCClient dials its peer
+// connections through its own, separate dial path, which this package does
+// not own. Wiring mTLS in cluster-wide therefore also requires pointing
+// that dialer at dialControlPeer, not just populating
+// globalControlMTLSConfig.
+func dialControlPeer(network, address string) (net.Conn, error) {
+	if !globalControlMTLSConfig.Enabled {
+		return net.Dial(network, address)
+	}
+	cfg := controlPeerTLSConfig(globalControlMTLSConfig.NodeCert, globalControlMTLSConfig.ClusterCA)
+	return tls.Dial(network, address, cfg)
+}
@@ -17,8 +17,8 @@
 package cmd
 
 import (
+	"context"
 	"errors"
-	"sync"
 	"time"
 )
 
@@ -42,7 +42,7 @@ func (c *controlAPIHandlers) LoginHandler(args *RPCLoginArgs, reply *RPCLoginRep
 	if err = jwt.Authenticate(args.Username, args.Password); err != nil {
 		return err
 	}
-	token, err := jwt.GenerateToken(args.Username)
+	token, err := jwt.GenerateToken(args.Username, defaultLoginCapabilities)
 	if err != nil {
 		return err
 	}
@@ -77,8 +77,8 @@ func (c *controlAPIHandlers) ListObjectsHealHandler(args *HealListArgs, reply *H
 	if objAPI == nil {
 		return errServerNotInitialized
 	}
-	if !isRPCTokenValid(args.Token) {
-		return errInvalidToken
+	if err := isRPCTokenAuthorized(args.Token, "Control.ListObjectsHealHandler", 0); err != nil {
+		return err
 	}
 	info, err := objAPI.ListObjectsHeal(args.Bucket, args.Prefix, args.Marker, args.Delimiter, args.MaxKeys)
 	if err != nil {
@@ -104,25 +104,227 @@ type HealObjectArgs struct {
 	Object string
 }
 
-// HealObjectReply - reply by HealObject RPC.
-type HealObjectReply struct{}
+// HealObjectReply - reply by HealObject RPC, carries the job ID callers use
+// to poll HealStatusHandler or abort the heal via HealCancelHandler.
+type HealObjectReply struct {
+	JobID healJobID
+}
 
-// HealObject - heal the object.
-func (c *controlAPIHandlers) HealObjectHandler(args *HealObjectArgs, reply *GenericReply) error {
+// HealObject - kicks off healing of a single object in the background and
+// returns immediately with a job ID. Use HealStatusHandler to follow
+// progress.
+func (c *controlAPIHandlers) HealObjectHandler(args *HealObjectArgs, reply *HealObjectReply) error {
 	objAPI := c.ObjectAPI()
 	if objAPI == nil {
 		return errServerNotInitialized
 	}
-	if !isRPCTokenValid(args.Token) {
-		return errInvalidToken
+	if err := isRPCTokenAuthorized(args.Token, "Control.HealObjectHandler", 0); err != nil {
+		return err
+	}
+	job := globalHealJobManager.newObjectHealJob(args.Bucket, args.Object)
+	go func() {
+		c.healObjectsAsync(objAPI, job, []string{args.Object})
+		globalHealJobManager.finish(job.ID)
+	}()
+	reply.JobID = job.ID
+	return nil
+}
+
+// HealBucketArgs - argument for the bulk HealBucket RPC.
+type HealBucketArgs struct {
+	// Authentication token generated by Login.
+	GenericArgs
+
+	// Name of the bucket.
+	Bucket string
+
+	// Prefix to restrict the heal walk to, empty heals the whole bucket.
+	Prefix string
+}
+
+// HealBucketReply - reply by HealBucket RPC, carries the job ID callers use
+// to poll HealStatusHandler or abort the heal via HealCancelHandler.
+type HealBucketReply struct {
+	JobID healJobID
+}
+
+// HealBucket - walks every object under bucket/prefix and heals it in the
+// background, returning immediately with a job ID.
+func (c *controlAPIHandlers) HealBucketHandler(args *HealBucketArgs, reply *HealBucketReply) error {
+	objAPI := c.ObjectAPI()
+	if objAPI == nil {
+		return errServerNotInitialized
+	}
+	if err := isRPCTokenAuthorized(args.Token, "Control.HealBucketHandler", 0); err != nil {
+		return err
+	}
+	job := globalHealJobManager.newHealJob(args.Bucket, args.Prefix)
+	go c.healBucketAsync(objAPI, job, args.Bucket, args.Prefix)
+	reply.JobID = job.ID
+	return nil
+}
+
+// healObjectsAsync heals each of the given objects in turn, updating job
+// progress as it goes, honouring cancellation between objects. Every object
+// is recorded as healStatePending up front, before any of them start
+// healing, so a caller polling HealStatusHandler sees queued objects rather
+// than only the ones that have already begun.
+//
+// objAPI.HealObject reports one healDiskProgress per disk it touched
+// (including bytes repaired and any per-disk error); the object's overall
+// state is healed only if every disk succeeded.
+//
+// It does not mark the job finished; the caller does, once every object of
+// the job has been handled.
+func (c *controlAPIHandlers) healObjectsAsync(objAPI ObjectLayer, job *healJob, objects []string) {
+	for _, object := range objects {
+		globalHealJobManager.update(job.ID, healObjectProgress{
+			Bucket: job.Bucket,
+			Object: object,
+			State:  healStatePending,
+		})
+	}
+	for _, object := range objects {
+		select {
+		case <-job.cancelCh:
+			return
+		default:
+		}
+		globalHealJobManager.update(job.ID, healObjectProgress{
+			Bucket: job.Bucket,
+			Object: object,
+			State:  healStateHealing,
+		})
+		disks, err := objAPI.HealObject(job.Bucket, object)
+		if err != nil {
+			errorIf(err, "Unable to heal object %s/%s", job.Bucket, object)
+		}
+		state := healStateHealed
+		if err != nil {
+			state = healStateFailed
+		}
+		for _, d := range disks {
+			if d.State == healStateFailed {
+				state = healStateFailed
+				break
+			}
+		}
+		globalHealJobManager.update(job.ID, healObjectProgress{
+			Bucket: job.Bucket,
+			Object: object,
+			State:  state,
+			Disks:  disks,
+		})
+	}
+}
+
+// healBucketAsync pages through every object under bucket/prefix via the
+// same listing used by ListObjectsHealHandler and heals each one.
+func (c *controlAPIHandlers) healBucketAsync(objAPI ObjectLayer, job *healJob, bucket, prefix string) {
+	marker := ""
+	for {
+		select {
+		case <-job.cancelCh:
+			globalHealJobManager.finish(job.ID)
+			return
+		default:
+		}
+		info, err := objAPI.ListObjectsHeal(bucket, prefix, marker, "", maxObjectList)
+		if err != nil {
+			errorIf(err, "Unable to list objects to heal in %s/%s", bucket, prefix)
+			globalHealJobManager.finish(job.ID)
+			return
+		}
+		objects := make([]string, 0, len(info.Objects))
+		for _, obj := range info.Objects {
+			objects = append(objects, obj.Name)
+		}
+		c.healObjectsAsync(objAPI, job, objects)
+		if !info.IsTruncated {
+			break
+		}
+		marker = info.NextMarker
+	}
+	globalHealJobManager.finish(job.ID)
+}
+
+// HealStatusArgs - argument for the HealStatus RPC.
+type HealStatusArgs struct {
+	// Authentication token generated by Login.
+	GenericArgs
+
+	// JobID returned by HealObjectHandler or HealBucketHandler.
+	JobID healJobID
+}
+
+// HealStatusReply - snapshot of a heal job's progress. Clients poll
+// HealStatusHandler and render this repeatedly to show a live progress bar.
+// At most one of Prefix (a HealBucket job, empty when the whole bucket is
+// healed) or Object (a HealObject job) is populated, matching healJob's
+// identity.
+type HealStatusReply struct {
+	Bucket    string
+	Prefix    string
+	Object    string
+	Done      bool
+	Cancelled bool
+	Objects   []healObjectProgress
+}
+
+// HealStatus - reports progress of a previously started heal job. Safe to
+// call after the client that started the heal has reconnected, since job
+// state is persisted independently of any single RPC connection.
+func (c *controlAPIHandlers) HealStatusHandler(args *HealStatusArgs, reply *HealStatusReply) error {
+	if err := isRPCTokenAuthorized(args.Token, "Control.HealStatusHandler", 0); err != nil {
+		return err
+	}
+	job, err := globalHealJobManager.snapshot(args.JobID)
+	if err != nil {
+		return err
 	}
-	return objAPI.HealObject(args.Bucket, args.Object)
+	reply.Bucket = job.Bucket
+	reply.Prefix = job.Prefix
+	reply.Object = job.Object
+	reply.Done = job.Done
+	reply.Cancelled = job.Cancelled
+	reply.Objects = job.Objects
+	return nil
+}
+
+// HealCancelArgs - argument for the HealCancel RPC.
+type HealCancelArgs struct {
+	// Authentication token generated by Login.
+	GenericArgs
+
+	// JobID returned by HealObjectHandler or HealBucketHandler.
+	JobID healJobID
+}
+
+// HealCancel - aborts a previously started heal job before its next
+// checkpoint. Objects already healed are left as-is.
+func (c *controlAPIHandlers) HealCancelHandler(args *HealCancelArgs, reply *GenericReply) error {
+	if err := isRPCTokenAuthorized(args.Token, "Control.HealCancelHandler", 0); err != nil {
+		return err
+	}
+	return globalHealJobManager.cancel(args.JobID)
 }
 
 // HealObject - heal the object.
 func (c *controlAPIHandlers) HealDiskMetadataHandler(args *GenericArgs, reply *GenericReply) error {
-	if !isRPCTokenValid(args.Token) {
-		return errInvalidToken
+	if err := isRPCTokenAuthorized(args.Token, "Control.HealDiskMetadataHandler", 0); err != nil {
+		return err
+	}
+	if !args.Remote {
+		ctx, cancel := context.WithTimeout(context.Background(), peerBroadcastTimeout)
+		defer cancel()
+		results := peerBroadcast(ctx, c.RemoteControls, "Control.HealDiskMetadataHandler",
+			func(i int) interface{} { return &GenericArgs{Token: args.Token, Remote: true} },
+			func() interface{} { return &GenericReply{} })
+		for _, r := range results {
+			if r.Err != nil {
+				errorIf(r.Err, "Peer %s failed to repair disk metadata", r.Node)
+			}
+		}
 	}
 	err := repairDiskMetadata(c.StorageDisks)
 	if err != nil {
@@ -134,6 +336,35 @@ func (c *controlAPIHandlers) HealDiskMetadataHandler(args *GenericArgs, reply *G
 	return err
 }
 
+// HealSchedulerStatusReply - snapshot of the background healing scheduler's
+// configuration, so operators can confirm what an earlier config change
+// actually took effect as.
+type HealSchedulerStatusReply struct {
+	Enabled               bool
+	MaxConcurrentHeals    int
+	MaxIOPSPerDisk        int
+	MaxBytesPerSecPerDisk int64
+	ActiveWindowStart     int
+	ActiveWindowEnd       int
+}
+
+// HealSchedulerStatus - reports the background heal scheduler's current
+// configuration. The scheduler itself runs continuously once enabled; this
+// handler exists purely for visibility into that already-running process.
+func (c *controlAPIHandlers) HealSchedulerStatusHandler(args *GenericArgs, reply *HealSchedulerStatusReply) error {
+	if err := isRPCTokenAuthorized(args.Token, "Control.HealSchedulerStatusHandler", 0); err != nil {
+		return err
+	}
+	cfg := globalHealScheduler.config
+	reply.Enabled = cfg.Enabled
+	reply.MaxConcurrentHeals = cfg.MaxConcurrentHeals
+	reply.MaxIOPSPerDisk = cfg.MaxIOPSPerDisk
+	reply.MaxBytesPerSecPerDisk = cfg.MaxBytesPerSecPerDisk
+	reply.ActiveWindowStart = cfg.ActiveWindowStart
+	reply.ActiveWindowEnd = cfg.ActiveWindowEnd
+	return nil
+}
+
 // ServiceArgs - argument for Service RPC.
 type ServiceArgs struct {
 	// Authentication token generated by Login.
@@ -145,37 +376,63 @@ type ServiceArgs struct {
 	Signal serviceSignal
 }
 
-// ServiceReply - represents service operation success info.
+// ServiceNodeResult - one peer's outcome from a cluster-wide Service call.
+type ServiceNodeResult struct {
+	Node        string
+	StorageInfo StorageInfo
+	Err         string
+	Latency     time.Duration
+}
+
+// ServiceReply - represents service operation success info. NodeResults is
+// only populated for a cluster-wide call (args.Remote == true on the node
+// that received the original request) and holds one entry per peer so
+// `minio control` can show exactly which nodes acknowledged and which
+// timed out.
 type ServiceReply struct {
 	StorageInfo StorageInfo
+	NodeResults []ServiceNodeResult
 }
 
-// Remote procedure call, calls serviceMethod with given input args.
-func (c *controlAPIHandlers) remoteServiceCall(args *ServiceArgs, replies []*ServiceReply) error {
-	var wg sync.WaitGroup
-	var errs = make([]error, len(c.RemoteControls))
-	// Send remote call to all neighboring peers to restart minio servers.
-	for index, clnt := range c.RemoteControls {
-		wg.Add(1)
-		go func(index int, client *AuthRPCClient) {
-			defer wg.Done()
-			errs[index] = client.Call("Control.ServiceHandler", args, replies[index])
-			errorIf(errs[index], "Unable to initiate control service request to remote node %s", client.Node())
-		}(index, clnt)
-	}
-	wg.Wait()
-	for _, err := range errs {
-		if err != nil {
-			return err
+// peerBroadcastTimeout bounds how long a control handler waits on peers
+// before giving up on the stragglers and reporting them as timed out.
+const peerBroadcastTimeout = 30 * time.Second
+
+// remoteServiceCall fans args out to every peer via peerBroadcast and
+// collects one ServiceNodeResult per peer. A peer that errors or times out
+// only shows up as a failed entry - it no longer stalls or fails the call
+// for the rest of the cluster.
+func (c *controlAPIHandlers) remoteServiceCall(args *ServiceArgs) []ServiceNodeResult {
+	ctx, cancel := context.WithTimeout(context.Background(), peerBroadcastTimeout)
+	defer cancel()
+
+	results := peerBroadcast(ctx, c.RemoteControls, "Control.ServiceHandler",
+		func(i int) interface{} {
+			a := *args
+			a.Remote = false
+			return &a
+		},
+		func() interface{} { return &ServiceReply{} })
+
+	nodeResults := make([]ServiceNodeResult, len(results))
+	for i, r := range results {
+		nodeResults[i] = ServiceNodeResult{Node: r.Node, Latency: r.Latency}
+		if r.Err != nil {
+			errorIf(r.Err, "Unable to complete control service request on remote node %s", r.Node)
+			nodeResults[i].Err = r.Err.Error()
+			continue
+		}
+		if reply, ok := r.Reply.(*ServiceReply); ok && reply != nil {
+			nodeResults[i].StorageInfo = reply.StorageInfo
 		}
 	}
-	return nil
+	return nodeResults
 }
 
 // Service - handler for sending service signals across many servers.
 func (c *controlAPIHandlers) ServiceHandler(args *ServiceArgs, reply *ServiceReply) error {
-	if !isRPCTokenValid(args.Token) {
-		return errInvalidToken
+	if err := isRPCTokenAuthorized(args.Token, "Control.ServiceHandler", args.Signal); err != nil {
+		return err
 	}
 	objAPI := c.ObjectAPI()
 	if objAPI == nil {
@@ -185,24 +442,15 @@ func (c *controlAPIHandlers) ServiceHandler(args *ServiceArgs, reply *ServiceRep
 		reply.StorageInfo = objAPI.StorageInfo()
 		return nil
 	}
-	var replies = make([]*ServiceReply, len(c.RemoteControls))
 	switch args.Signal {
 	case serviceRestart:
 		if args.Remote {
-			// Set remote as false for remote calls.
-			args.Remote = false
-			if err := c.remoteServiceCall(args, replies); err != nil {
-				return err
-			}
+			reply.NodeResults = c.remoteServiceCall(args)
 		}
 		globalServiceSignalCh <- serviceRestart
 	case serviceStop:
 		if args.Remote {
-			// Set remote as false for remote calls.
-			args.Remote = false
-			if err := c.remoteServiceCall(args, replies); err != nil {
-				return err
-			}
+			reply.NodeResults = c.remoteServiceCall(args)
 		}
 		globalServiceSignalCh <- serviceStop
 	}
@@ -211,12 +459,29 @@ func (c *controlAPIHandlers) ServiceHandler(args *ServiceArgs, reply *ServiceRep
 
 // LockInfo - RPC control handler for `minio control lock`. Returns the info of the locks held in the system.
 func (c *controlAPIHandlers) TryInitHandler(args *GenericArgs, reply *GenericReply) error {
-	if !isRPCTokenValid(args.Token) {
-		return errInvalidToken
+	if err := isRPCTokenAuthorized(args.Token, "Control.TryInitHandler", 0); err != nil {
+		return err
+	}
+	if !args.Remote {
+		ctx, cancel := context.WithTimeout(context.Background(), peerBroadcastTimeout)
+		defer cancel()
+		results := peerBroadcast(ctx, c.RemoteControls, "Control.TryInitHandler",
+			func(i int) interface{} { return &GenericArgs{Token: args.Token, Remote: true} },
+			func() interface{} { return &GenericReply{} })
+		for _, r := range results {
+			if r.Err != nil {
+				errorIf(r.Err, "Peer %s failed to acknowledge TryInit", r.Node)
+			}
+		}
 	}
 	go func() {
 		globalWakeupCh <- struct{}{}
 	}()
+	if objAPI := c.ObjectAPI(); objAPI != nil {
+		healSchedulerStartOnce.Do(func() {
+			globalHealScheduler.Start(objAPI, globalHealSchedulerConfig)
+		})
+	}
 	*reply = GenericReply{}
 	return nil
-}
\ No newline at end of file
+}
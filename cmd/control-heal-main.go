@@ -0,0 +1,133 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/minio/cli"
+)
+
+// healCmd - `minio control heal` - kicks off a bucket heal and renders a
+// live progress bar until it finishes or is interrupted with Ctrl-C, in
+// which case the in-progress job is left running server side. The job ID is
+// printed when the heal starts so it can be resumed with `heal-status`.
+var healCmd = cli.Command{
+	Name:   "heal",
+	Usage:  "Heal a bucket and watch progress.",
+	Action: healControl,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "prefix",
+			Usage: "Restrict the heal to this prefix.",
+		},
+	},
+}
+
+// healStatusCmd - `minio control heal-status` - attaches to an already
+// running heal job (for example after a dropped connection) and resumes
+// rendering its progress bar.
+var healStatusCmd = cli.Command{
+	Name:   "heal-status",
+	Usage:  "Show progress of a previously started heal job.",
+	Action: healStatusControl,
+}
+
+// healCancelCmd - `minio control heal-cancel` - aborts a running heal job.
+var healCancelCmd = cli.Command{
+	Name:   "heal-cancel",
+	Usage:  "Cancel a previously started heal job.",
+	Action: healCancelControl,
+}
+
+// healControl - starts a bucket heal and streams its progress.
+func healControl(c *cli.Context) {
+	if !c.Args().Present() {
+		cli.ShowCommandHelpAndExit(c, "heal", 1)
+	}
+	bucket := c.Args().First()
+
+	client, err := getControlClient(c)
+	fatalIf(err, "Unable to create control RPC client.")
+
+	args := HealBucketArgs{Bucket: bucket, Prefix: c.String("prefix")}
+	var reply HealBucketReply
+	fatalIf(client.Call("Control.HealBucketHandler", &args, &reply), "Unable to start heal.")
+
+	fmt.Printf("Heal started, job id %s\n", reply.JobID)
+	watchHealJob(client, reply.JobID)
+}
+
+// healStatusControl - resumes watching a heal job given its ID.
+func healStatusControl(c *cli.Context) {
+	if !c.Args().Present() {
+		cli.ShowCommandHelpAndExit(c, "heal-status", 1)
+	}
+	client, err := getControlClient(c)
+	fatalIf(err, "Unable to create control RPC client.")
+	watchHealJob(client, healJobID(c.Args().First()))
+}
+
+// healCancelControl - aborts a running heal job by ID.
+func healCancelControl(c *cli.Context) {
+	if !c.Args().Present() {
+		cli.ShowCommandHelpAndExit(c, "heal-cancel", 1)
+	}
+	client, err := getControlClient(c)
+	fatalIf(err, "Unable to create control RPC client.")
+
+	args := HealCancelArgs{JobID: healJobID(c.Args().First())}
+	var reply GenericReply
+	fatalIf(client.Call("Control.HealCancelHandler", &args, &reply), "Unable to cancel heal.")
+	fmt.Println("Heal cancelled.")
+}
+
+// watchHealJob polls HealStatusHandler until the job reports done,
+// redrawing a single progress line in place.
+func watchHealJob(client *AuthRPCClient, jobID healJobID) {
+	args := HealStatusArgs{JobID: jobID}
+	for {
+		var reply HealStatusReply
+		if err := client.Call("Control.HealStatusHandler", &args, &reply); err != nil {
+			errorIf(err, "Unable to fetch heal status.")
+			return
+		}
+
+		var healed, failed, total int
+		for _, obj := range reply.Objects {
+			total++
+			switch obj.State {
+			case healStateHealed:
+				healed++
+			case healStateFailed:
+				failed++
+			}
+		}
+		fmt.Printf("\r%s: %d/%d healed, %d failed", reply.Bucket, healed, total, failed)
+
+		if reply.Done {
+			if reply.Cancelled {
+				fmt.Println("\nHeal cancelled.")
+			} else {
+				fmt.Println("\nHeal complete.")
+			}
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
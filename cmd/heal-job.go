@@ -0,0 +1,307 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// errHealJobNotFound - no heal job is known by the given ID.
+var errHealJobNotFound = errors.New("Heal job not found.")
+
+// healObjectState - state of a single object (or disk) within a heal job.
+type healObjectState int
+
+const (
+	healStatePending healObjectState = iota
+	healStateHealing
+	healStateHealed
+	healStateFailed
+	healStateCancelled
+)
+
+// healDiskProgress - per-disk progress for a single object being healed.
+type healDiskProgress struct {
+	Disk          string
+	State         healObjectState
+	BytesRepaired int64
+	Error         string
+}
+
+// healObjectProgress - progress for a single object within a heal job.
+type healObjectProgress struct {
+	Bucket string
+	Object string
+	State  healObjectState
+	Disks  []healDiskProgress
+}
+
+// healJobID - unique identifier handed back to the caller of HealObject/HealBucket.
+type healJobID string
+
+// healJob tracks the state of one in-flight (or completed) heal operation so
+// that HealStatusHandler can report progress and HealCancelHandler can abort
+// it. A healJob is persisted to disk so that progress survives a client
+// disconnecting and reconnecting later with the same job ID.
+//
+// At most one of Prefix (a HealBucket job, empty when the whole bucket is
+// healed) or Object (a HealObject job) is set - they are distinct identities and must not be conflated, since a
+// bucket-job's Prefix is a heal-walk scope while an object-job's Object
+// names a single key.
+type healJob struct {
+	ID        healJobID
+	Bucket    string
+	Prefix    string
+	Object    string
+	StartedAt time.Time
+	UpdatedAt time.Time
+	Done      bool
+	Cancelled bool
+	Objects   []healObjectProgress
+
+	cancelCh chan struct{}
+}
+
+// healJobManager keeps every heal job known to this node in memory and
+// mirrors it to disk so that `HealStatusHandler` can be served even across a
+// server restart.
+type healJobManager struct {
+	mu   sync.Mutex
+	jobs map[healJobID]*healJob
+}
+
+// globalHealJobManager - process wide heal job tracker, mirrors the pattern
+// of other `global*` singletons used to thread state through the control
+// handlers.
+var globalHealJobManager = newHealJobManager()
+
+func newHealJobManager() *healJobManager {
+	return &healJobManager{
+		jobs: make(map[healJobID]*healJob),
+	}
+}
+
+// newHealJob registers a new bucket-level (HealBucket) job and returns its
+// ID to the caller. prefix scopes the heal walk; pass "" to heal the whole
+// bucket.
+func (m *healJobManager) newHealJob(bucket, prefix string) *healJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job := &healJob{
+		ID:        healJobID(mustGetUUID()),
+		Bucket:    bucket,
+		Prefix:    prefix,
+		StartedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		cancelCh:  make(chan struct{}),
+	}
+	m.jobs[job.ID] = job
+	m.persist(job)
+	return job
+}
+
+// newObjectHealJob registers a new single-object (HealObject) job and
+// returns its ID to the caller. Kept distinct from newHealJob so a single
+// object key is never reported back out as a bucket "Prefix".
+func (m *healJobManager) newObjectHealJob(bucket, object string) *healJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job := &healJob{
+		ID:        healJobID(mustGetUUID()),
+		Bucket:    bucket,
+		Object:    object,
+		StartedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		cancelCh:  make(chan struct{}),
+	}
+	m.jobs[job.ID] = job
+	m.persist(job)
+	return job
+}
+
+// healJobSnapshot is a point-in-time, race-free copy of a healJob's
+// reportable state. update/finish/cancel mutate the live *healJob
+// (including appending to Objects, which can reallocate its backing array)
+// so callers outside healJobManager must never read a *healJob directly -
+// snapshot is the only safe way to observe one.
+type healJobSnapshot struct {
+	Bucket    string
+	Prefix    string
+	Object    string
+	Done      bool
+	Cancelled bool
+	Objects   []healObjectProgress
+}
+
+// snapshot returns a copy of the job's current state for the given ID,
+// loading it from disk if it is not currently resident in memory (e.g.
+// after a restart). The copy is taken while m.mu is held so it can never
+// race with a concurrent update/finish/cancel.
+func (m *healJobManager) snapshot(id healJobID) (*healJobSnapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		loaded, err := m.load(id)
+		if err != nil {
+			return nil, err
+		}
+		m.jobs[id] = loaded
+		job = loaded
+	}
+
+	objects := make([]healObjectProgress, len(job.Objects))
+	copy(objects, job.Objects)
+	return &healJobSnapshot{
+		Bucket:    job.Bucket,
+		Prefix:    job.Prefix,
+		Object:    job.Object,
+		Done:      job.Done,
+		Cancelled: job.Cancelled,
+		Objects:   objects,
+	}, nil
+}
+
+// update records progress for a single object within the job and persists
+// the new state to disk.
+func (m *healJobManager) update(id healJobID, progress healObjectProgress) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return errHealJobNotFound
+	}
+	for i := range job.Objects {
+		if job.Objects[i].Bucket == progress.Bucket && job.Objects[i].Object == progress.Object {
+			job.Objects[i] = progress
+			job.UpdatedAt = time.Now().UTC()
+			m.persist(job)
+			return nil
+		}
+	}
+	job.Objects = append(job.Objects, progress)
+	job.UpdatedAt = time.Now().UTC()
+	m.persist(job)
+	return nil
+}
+
+// finish marks the job as complete and persists the final state.
+func (m *healJobManager) finish(id healJobID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return
+	}
+	job.Done = true
+	job.UpdatedAt = time.Now().UTC()
+	m.persist(job)
+}
+
+// cancel signals the goroutine driving the heal job to stop at its next
+// checkpoint.
+func (m *healJobManager) cancel(id healJobID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return errHealJobNotFound
+	}
+	if job.Done {
+		return nil
+	}
+	select {
+	case <-job.cancelCh:
+		// already cancelled.
+	default:
+		close(job.cancelCh)
+	}
+	job.Cancelled = true
+	job.Done = true
+	job.UpdatedAt = time.Now().UTC()
+	m.persist(job)
+	return nil
+}
+
+// healJobStateDir - directory used to persist heal job state so that it
+// survives a client reconnecting (or the server restarting) mid-heal.
+func healJobStateDir() (string, error) {
+	configDir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(configDir, "heal-jobs")
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// persist - best effort sync of the job state to disk. Errors are logged,
+// not returned, so that a failure to persist never aborts an in-flight heal.
+func (m *healJobManager) persist(job *healJob) {
+	dir, err := healJobStateDir()
+	if err != nil {
+		errorIf(err, "Unable to persist heal job %s", job.ID)
+		return
+	}
+	b, err := json.Marshal(job)
+	if err != nil {
+		errorIf(err, "Unable to marshal heal job %s", job.ID)
+		return
+	}
+	path := filepath.Join(dir, string(job.ID)+".json")
+	if err = ioutil.WriteFile(path, b, 0600); err != nil {
+		errorIf(err, "Unable to write heal job state %s", path)
+	}
+}
+
+// load - reconstructs a healJob from its persisted state on disk.
+func (m *healJobManager) load(id healJobID) (*healJob, error) {
+	dir, err := healJobStateDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, string(id)+".json")
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errHealJobNotFound
+		}
+		return nil, err
+	}
+	job := &healJob{cancelCh: make(chan struct{})}
+	if err = json.Unmarshal(b, job); err != nil {
+		return nil, err
+	}
+	if job.Cancelled {
+		close(job.cancelCh)
+	}
+	return job, nil
+}
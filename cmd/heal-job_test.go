@@ -0,0 +1,164 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestHealJobManagerPersistLoadRoundTrip verifies that a job evicted from
+// the in-memory map (simulating a restart) comes back with the same state
+// via snapshot()'s fall-through to load().
+func TestHealJobManagerPersistLoadRoundTrip(t *testing.T) {
+	m := newHealJobManager()
+	job := m.newHealJob("bucket", "prefix")
+	if err := m.update(job.ID, healObjectProgress{Bucket: "bucket", Object: "obj1", State: healStateHealed}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	// Simulate a restart: drop the in-memory entry, forcing snapshot() to
+	// reload it from the file update() persisted.
+	m.mu.Lock()
+	delete(m.jobs, job.ID)
+	m.mu.Unlock()
+
+	snap, err := m.snapshot(job.ID)
+	if err != nil {
+		t.Fatalf("snapshot after simulated restart: %v", err)
+	}
+	if snap.Bucket != "bucket" || snap.Prefix != "prefix" {
+		t.Fatalf("reloaded job has wrong identity: %+v", snap)
+	}
+	if len(snap.Objects) != 1 || snap.Objects[0].State != healStateHealed {
+		t.Fatalf("reloaded job lost its progress: %+v", snap.Objects)
+	}
+}
+
+// TestHealJobManagerSnapshotUnknownJob verifies that an ID that was never
+// created and has nothing on disk surfaces errHealJobNotFound rather than
+// panicking or returning a zero-value snapshot.
+func TestHealJobManagerSnapshotUnknownJob(t *testing.T) {
+	m := newHealJobManager()
+	if _, err := m.snapshot("does-not-exist"); err != errHealJobNotFound {
+		t.Fatalf("snapshot() on unknown job = %v, want errHealJobNotFound", err)
+	}
+}
+
+// TestHealJobManagerUpdateAndSnapshot verifies that update() records
+// per-object progress and that snapshot() returns it back out again.
+func TestHealJobManagerUpdateAndSnapshot(t *testing.T) {
+	m := newHealJobManager()
+	job := m.newHealJob("bucket", "prefix")
+
+	if err := m.update(job.ID, healObjectProgress{Bucket: "bucket", Object: "obj1", State: healStateHealing}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := m.update(job.ID, healObjectProgress{Bucket: "bucket", Object: "obj1", State: healStateHealed}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	snap, err := m.snapshot(job.ID)
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if len(snap.Objects) != 1 {
+		t.Fatalf("expected 1 object, got %d", len(snap.Objects))
+	}
+	if snap.Objects[0].State != healStateHealed {
+		t.Fatalf("expected obj1 to be healed, got state %v", snap.Objects[0].State)
+	}
+	if snap.Done {
+		t.Fatalf("job should not be done until finish() is called")
+	}
+
+	m.finish(job.ID)
+	snap, err = m.snapshot(job.ID)
+	if err != nil {
+		t.Fatalf("snapshot after finish: %v", err)
+	}
+	if !snap.Done {
+		t.Fatalf("expected job to be done after finish()")
+	}
+}
+
+// TestHealJobManagerCancel verifies cancel() marks the job done/cancelled
+// and closes its cancelCh so an in-flight heal loop observes it.
+func TestHealJobManagerCancel(t *testing.T) {
+	m := newHealJobManager()
+	job := m.newHealJob("bucket", "")
+
+	if err := m.cancel(job.ID); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	select {
+	case <-job.cancelCh:
+	default:
+		t.Fatalf("expected cancelCh to be closed after cancel()")
+	}
+
+	snap, err := m.snapshot(job.ID)
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if !snap.Done || !snap.Cancelled {
+		t.Fatalf("expected job to be Done and Cancelled, got %+v", snap)
+	}
+
+	// Cancelling an already-cancelled job must not panic (double close).
+	if err := m.cancel(job.ID); err != nil {
+		t.Fatalf("second cancel: %v", err)
+	}
+}
+
+// TestHealJobManagerSnapshotIsolation ensures the Objects slice returned by
+// snapshot is a copy: appending to the live job afterwards must not mutate
+// a snapshot taken earlier, and racing update()/snapshot() calls must not
+// be flagged by the race detector.
+func TestHealJobManagerSnapshotIsolation(t *testing.T) {
+	m := newHealJobManager()
+	job := m.newHealJob("bucket", "")
+
+	snap, err := m.snapshot(job.ID)
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m.update(job.ID, healObjectProgress{Bucket: "bucket", Object: string(rune('a' + i%26))})
+		}(i)
+	}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.snapshot(job.ID); err != nil {
+				t.Errorf("snapshot: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(snap.Objects) != 0 {
+		t.Fatalf("snapshot taken before any updates should stay empty, got %d objects", len(snap.Objects))
+	}
+}
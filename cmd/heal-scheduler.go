@@ -0,0 +1,369 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// errLeaseRenewalFailed - a bucket range lease could not be renewed, most
+// likely because another peer has since taken over the range.
+var errLeaseRenewalFailed = errors.New("Unable to renew background heal lease, bucket range may have been taken over by another peer.")
+
+// healSchedulerConfig - operator tunable knobs for the background healing
+// scheduler. It is not part of `serverConfig`; the scheduler reads it from
+// globalHealSchedulerConfig.
+type healSchedulerConfig struct {
+	// Enabled turns the background scanner on or off.
+	Enabled bool
+
+	// MaxConcurrentHeals bounds how many objects are healed at once.
+	MaxConcurrentHeals int
+
+	// MaxIOPSPerDisk and MaxBytesPerSecPerDisk set the limits of each
+	// diskRateLimiter. healBucketInBackground keys those limiters by bucket
+	// name, not by disk, and charges each object as one operation of one
+	// byte (see healBucketInBackground).
+	MaxIOPSPerDisk        int
+	MaxBytesPerSecPerDisk int64
+
+	// ActiveWindowStart and ActiveWindowEnd restrict background healing to
+	// a time-of-day window, expressed as minutes since midnight UTC. A
+	// window where Start == End means no restriction.
+	ActiveWindowStart int
+	ActiveWindowEnd   int
+}
+
+// withinWindow reports whether t falls inside the configured time-of-day
+// window, treating an empty window (Start == End) as always-on.
+func (cfg healSchedulerConfig) withinWindow(t time.Time) bool {
+	if cfg.ActiveWindowStart == cfg.ActiveWindowEnd {
+		return true
+	}
+	minutes := t.Hour()*60 + t.Minute()
+	if cfg.ActiveWindowStart < cfg.ActiveWindowEnd {
+		return minutes >= cfg.ActiveWindowStart && minutes < cfg.ActiveWindowEnd
+	}
+	// window wraps past midnight, e.g. 23:00 -> 05:00.
+	return minutes >= cfg.ActiveWindowStart || minutes < cfg.ActiveWindowEnd
+}
+
+// healCandidate - an object queued for background healing, ranked by how
+// many of its parity shards are still alive so that the most at-risk
+// objects are healed first.
+type healCandidate struct {
+	Bucket            string
+	Object            string
+	SurvivingParities int
+}
+
+// diskRateLimiter - simple fixed-window limiter that counts operations and
+// bytes per one-second window against the configured IOPS/bandwidth
+// ceiling. One limiter is shared by every heal that uses the same key in
+// limiterFor.
+type diskRateLimiter struct {
+	mu            sync.Mutex
+	maxIOPS       int
+	maxBytesPerS  int64
+	opsThisSecond int
+	bytesThisSec  int64
+	windowStart   time.Time
+}
+
+func newDiskRateLimiter(maxIOPS int, maxBytesPerSec int64) *diskRateLimiter {
+	return &diskRateLimiter{
+		maxIOPS:      maxIOPS,
+		maxBytesPerS: maxBytesPerSec,
+		windowStart:  time.Now(),
+	}
+}
+
+// wait blocks, if necessary, until the limiter has budget for one more
+// operation of the given size.
+func (d *diskRateLimiter) wait(size int64) {
+	for {
+		d.mu.Lock()
+		now := time.Now()
+		if now.Sub(d.windowStart) >= time.Second {
+			d.windowStart = now
+			d.opsThisSecond = 0
+			d.bytesThisSec = 0
+		}
+		iopsOK := d.maxIOPS <= 0 || d.opsThisSecond < d.maxIOPS
+		bytesOK := d.maxBytesPerS <= 0 || d.bytesThisSec < d.maxBytesPerS
+		if iopsOK && bytesOK {
+			d.opsThisSecond++
+			d.bytesThisSec += size
+			d.mu.Unlock()
+			return
+		}
+		d.mu.Unlock()
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// bucketRangeLease is held by the single node responsible for scanning and
+// healing a bucket in the background, renewed periodically through the
+// existing distributed lock subsystem so that at most one peer owns a given
+// bucket range at a time.
+type bucketRangeLease struct {
+	bucket   string
+	locker   RWLocker
+	renewed  time.Time
+	stopCh   chan struct{}
+	stopOnce sync.Once
+
+	// lostCh is closed the moment a renewal fails, i.e. another peer may
+	// now hold this bucket's range. Healing in progress must check this
+	// (not just stopCh, which only fires on a voluntary release) and stop
+	// as soon as it fires to avoid a split-brain double heal.
+	lostCh   chan struct{}
+	lostOnce sync.Once
+}
+
+// bucketRangeLeaseDuration - how long a lease is held before it must be
+// renewed. renewLoop renews it every third of this duration, so a slow scan
+// keeps the lease for as long as renewals succeed.
+const bucketRangeLeaseDuration = 30 * time.Second
+
+// acquireBucketRangeLease attempts to become the owner of the given bucket's
+// background heal range, using the same named-lock primitive the rest of the
+// server uses for inter-node coordination. Returns nil, false if another
+// peer already holds the lease.
+func acquireBucketRangeLease(bucket string) (*bucketRangeLease, bool) {
+	locker := globalNSMutex.NewNSLock("heal-scheduler", bucket, "")
+	if !locker.GetLock(bucketRangeLeaseDuration) {
+		return nil, false
+	}
+	lease := &bucketRangeLease{
+		bucket:  bucket,
+		locker:  locker,
+		renewed: time.Now(),
+		stopCh:  make(chan struct{}),
+		lostCh:  make(chan struct{}),
+	}
+	go lease.renewLoop()
+	return lease, true
+}
+
+// renewLoop periodically refreshes the lease until release is called, or
+// until a renewal fails - at which point another peer may already consider
+// itself the owner, so the lease is declared lost rather than silently kept
+// alive.
+func (l *bucketRangeLease) renewLoop() {
+	ticker := time.NewTicker(bucketRangeLeaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !l.locker.GetLock(bucketRangeLeaseDuration) {
+				errorIf(errLeaseRenewalFailed, "Lost background heal lease for bucket %s", l.bucket)
+				l.markLost()
+				return
+			}
+			l.renewed = time.Now()
+		case <-l.stopCh:
+			return
+		}
+	}
+}
+
+// Lost returns a channel that is closed as soon as this lease's renewal
+// fails. Anything healing under the lease must select on this (in addition
+// to stopCh) and abort immediately when it fires.
+func (l *bucketRangeLease) Lost() <-chan struct{} {
+	return l.lostCh
+}
+
+// markLost closes lostCh exactly once.
+func (l *bucketRangeLease) markLost() {
+	l.lostOnce.Do(func() {
+		close(l.lostCh)
+	})
+}
+
+// release gives up the lease so another peer may pick up the bucket range.
+func (l *bucketRangeLease) release() {
+	l.stopOnce.Do(func() {
+		close(l.stopCh)
+		l.locker.Unlock()
+	})
+}
+
+// healScheduler drives continuous, unattended background healing. One
+// instance runs per node; acquireBucketRangeLease ensures only the leaseholder
+// for a given bucket actually does work for it.
+type healScheduler struct {
+	objAPI ObjectLayer
+	config healSchedulerConfig
+
+	mu       sync.Mutex
+	limiters map[string]*diskRateLimiter
+}
+
+// globalHealScheduler - process wide background healing scheduler, started
+// once the object layer is initialized.
+var globalHealScheduler = &healScheduler{
+	limiters: make(map[string]*diskRateLimiter),
+}
+
+// globalHealSchedulerConfig - process wide background healing scheduler
+// settings. Nothing in the server assigns it, so it stays at its zero value
+// (Enabled == false) and TryInitHandler's Start call does not start the
+// scan/heal loop.
+var globalHealSchedulerConfig healSchedulerConfig
+
+// healSchedulerStartOnce ensures TryInitHandler only starts
+// globalHealScheduler once, even if TryInit is invoked more than once
+// against an already-initialized node.
+var healSchedulerStartOnce sync.Once
+
+// Start records objAPI and config, then begins the scan/heal loop in the
+// background if config.Enabled is set.
+func (h *healScheduler) Start(objAPI ObjectLayer, config healSchedulerConfig) {
+	h.objAPI = objAPI
+	h.config = config
+	if !config.Enabled {
+		return
+	}
+	go h.run()
+}
+
+// run loops forever, scanning every bucket once per pass and handing owned
+// buckets off to healBucketInBackground.
+func (h *healScheduler) run() {
+	for {
+		if !h.config.withinWindow(time.Now().UTC()) {
+			time.Sleep(time.Minute)
+			continue
+		}
+		buckets, err := h.objAPI.ListBuckets()
+		if err != nil {
+			errorIf(err, "Background heal scheduler unable to list buckets")
+			time.Sleep(time.Minute)
+			continue
+		}
+		for _, bucket := range buckets {
+			lease, ok := acquireBucketRangeLease(bucket.Name)
+			if !ok {
+				// Another peer owns this bucket's range right now.
+				continue
+			}
+			h.healBucketInBackground(bucket.Name, lease)
+			lease.release()
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+// limiterFor returns (creating if necessary) the rate limiter stored under
+// the given key, shared across every heal operation that uses that key.
+func (h *healScheduler) limiterFor(disk string) *diskRateLimiter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	limiter, ok := h.limiters[disk]
+	if !ok {
+		limiter = newDiskRateLimiter(h.config.MaxIOPSPerDisk, h.config.MaxBytesPerSecPerDisk)
+		h.limiters[disk] = limiter
+	}
+	return limiter
+}
+
+// healBucketInBackground walks bucket, heals objects with the fewest
+// surviving parity shards first, and honours the configured concurrency.
+// Rate limiting uses one limiter per bucket, not per disk, and charges each
+// object as one operation of one byte, so MaxBytesPerSecPerDisk does not
+// track the bytes actually healed. It stops as soon as lease.Lost() fires, since that
+// means another peer may already consider itself the owner of this bucket's
+// range.
+func (h *healScheduler) healBucketInBackground(bucket string, lease *bucketRangeLease) {
+	candidates, err := h.listHealCandidates(bucket)
+	if err != nil {
+		errorIf(err, "Background heal scheduler unable to list heal candidates in %s", bucket)
+		return
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].SurvivingParities < candidates[j].SurvivingParities
+	})
+
+	sem := make(chan struct{}, maxInt(h.config.MaxConcurrentHeals, 1))
+	var wg sync.WaitGroup
+	for _, candidate := range candidates {
+		select {
+		case <-lease.Lost():
+			wg.Wait()
+			return
+		default:
+		}
+		if !h.config.withinWindow(time.Now().UTC()) {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(c healCandidate) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			h.limiterFor(c.Bucket).wait(1)
+			select {
+			case <-lease.Lost():
+				return
+			default:
+			}
+			if _, err := h.objAPI.HealObject(c.Bucket, c.Object); err != nil {
+				errorIf(err, "Background heal failed for %s/%s", c.Bucket, c.Object)
+			}
+		}(candidate)
+	}
+	wg.Wait()
+}
+
+// listHealCandidates pages through bucket via ListObjectsHeal and ranks the
+// result by surviving parity shards so the most at-risk objects heal first.
+func (h *healScheduler) listHealCandidates(bucket string) ([]healCandidate, error) {
+	var candidates []healCandidate
+	marker := ""
+	for {
+		info, err := h.objAPI.ListObjectsHeal(bucket, "", marker, "", maxObjectList)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range info.Objects {
+			candidates = append(candidates, healCandidate{
+				Bucket:            bucket,
+				Object:            obj.Name,
+				SurvivingParities: obj.SurvivingParities,
+			})
+		}
+		if !info.IsTruncated {
+			break
+		}
+		marker = info.NextMarker
+	}
+	return candidates, nil
+}
+
+// maxInt returns the larger of a and b.
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
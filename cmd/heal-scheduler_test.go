@@ -0,0 +1,89 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestHealSchedulerConfigWithinWindow covers the no-restriction case, an
+// ordinary same-day window, and a window that wraps past midnight.
+func TestHealSchedulerConfigWithinWindow(t *testing.T) {
+	ref := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		cfg    healSchedulerConfig
+		t      time.Time
+		inside bool
+	}{
+		{"no restriction", healSchedulerConfig{}, ref.Add(13 * time.Hour), true},
+		{"inside same-day window", healSchedulerConfig{ActiveWindowStart: 60, ActiveWindowEnd: 120}, ref.Add(90 * time.Minute), true},
+		{"outside same-day window", healSchedulerConfig{ActiveWindowStart: 60, ActiveWindowEnd: 120}, ref.Add(10 * time.Hour), false},
+		{"inside wrapping window", healSchedulerConfig{ActiveWindowStart: 23 * 60, ActiveWindowEnd: 5 * 60}, ref.Add(1 * time.Hour), true},
+		{"outside wrapping window", healSchedulerConfig{ActiveWindowStart: 23 * 60, ActiveWindowEnd: 5 * 60}, ref.Add(12 * time.Hour), false},
+	}
+
+	for _, test := range tests {
+		if got := test.cfg.withinWindow(test.t); got != test.inside {
+			t.Errorf("%s: withinWindow() = %v, want %v", test.name, got, test.inside)
+		}
+	}
+}
+
+// TestDiskRateLimiterCapsIOPS verifies the limiter never lets more than
+// maxIOPS operations through within a single one-second window.
+func TestDiskRateLimiterCapsIOPS(t *testing.T) {
+	limiter := newDiskRateLimiter(5, 0)
+
+	var mu sync.Mutex
+	inWindow := 0
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		limiter.wait(1)
+		mu.Lock()
+		inWindow++
+		mu.Unlock()
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Fatalf("expected 5 ops within the 5/s budget to complete near-instantly, took %v", elapsed)
+	}
+	if inWindow != 5 {
+		t.Fatalf("expected 5 ops recorded, got %d", inWindow)
+	}
+
+	// A 6th op exceeds the 5/s budget and must wait for the next window.
+	limiter.wait(1)
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Fatalf("expected the 6th op to wait for the next one-second window, took only %v", elapsed)
+	}
+}
+
+// TestDiskRateLimiterUnlimited verifies a zero/negative limit means
+// unrestricted: diskRateLimiter.wait treats a limit <= 0 as no cap.
+func TestDiskRateLimiterUnlimited(t *testing.T) {
+	limiter := newDiskRateLimiter(0, 0)
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		limiter.wait(1 << 20)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("unlimited limiter should never block, took %v for 1000 ops", elapsed)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// peerResult is one peer's outcome from a peerBroadcast call: exactly one of
+// Reply/Err is meaningful, depending on whether the peer answered before the
+// context's deadline.
+type peerResult struct {
+	// Node is the peer this result came from.
+	Node string
+
+	// Reply holds the peer's response on success.
+	Reply interface{}
+
+	// Err is non-nil if the call failed or timed out.
+	Err error
+
+	// Latency is how long the call took (or how long we waited before
+	// giving up, for a timeout).
+	Latency time.Duration
+}
+
+// peerBroadcastMaxWorkers bounds how many peer RPCs are in flight at once so
+// a very large cluster doesn't spray thousands of concurrent goroutines and
+// connections at once.
+const peerBroadcastMaxWorkers = 32
+
+// peerBroadcast calls serviceMethod on every client in clients, building
+// args[i] via newArgs and collecting one peerResult per peer. A slow or
+// dead peer only affects its own peerResult -
+// it neither blocks nor fails the call for any other peer. Each individual
+// call is bounded by ctx (see callPeerWithContext), but peerBroadcast itself
+// always waits for every worker to write its slot before returning, so a
+// caller never observes a zero-value peerResult for a peer that simply
+// hasn't finished yet - every entry is either a real reply or a real error
+// (including ctx's deadline-exceeded error on timeout).
+//
+// newArgs is called once per peer (not shared) so callers can stamp
+// per-peer fields, e.g. disabling the Remote flag before forwarding.
+// newReply must return a fresh, distinct reply value per peer for the RPC
+// client to decode into.
+func peerBroadcast(ctx context.Context, clients []*AuthRPCClient, serviceMethod string, newArgs func(i int) interface{}, newReply func() interface{}) []peerResult {
+	return broadcastWorkers(len(clients), func(i int) peerResult {
+		return callPeerWithContext(ctx, clients[i], serviceMethod, newArgs(i), newReply())
+	})
+}
+
+// broadcastWorkers is the concurrency core of peerBroadcast: it runs call(i)
+// for every i in [0,n) across a pool bounded by peerBroadcastMaxWorkers and
+// collects one peerResult per index before returning. It is split out from
+// peerBroadcast so the worker-pool/result-completeness guarantees can be
+// exercised by tests with a fake call, independent of a real AuthRPCClient.
+func broadcastWorkers(n int, call func(i int) peerResult) []peerResult {
+	results := make([]peerResult, n)
+	sem := make(chan struct{}, peerBroadcastMaxWorkers)
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = call(i)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// callPeerWithContext performs a single RPC call, racing it against ctx so a
+// peer that never answers can't hold up the caller past the deadline.
+func callPeerWithContext(ctx context.Context, client *AuthRPCClient, serviceMethod string, args, reply interface{}) peerResult {
+	start := time.Now()
+	result := peerResult{Node: client.Node()}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.Call(serviceMethod, args, reply)
+	}()
+
+	select {
+	case err := <-errCh:
+		result.Err = err
+		result.Reply = reply
+	case <-ctx.Done():
+		result.Err = ctx.Err()
+		errorIf(result.Err, "Peer %s did not respond to %s before deadline", client.Node(), serviceMethod)
+	}
+	result.Latency = time.Since(start)
+	return result
+}
@@ -0,0 +1,94 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestBroadcastWorkersPartialFailure exercises peerBroadcast's concurrency
+// core (broadcastWorkers) with a mix of an immediate success, an immediate
+// error and a call that never returns - standing in for a peer that never
+// answers before ctx's deadline. It confirms every index gets exactly one
+// result, regardless of how its call resolved.
+func TestBroadcastWorkersPartialFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	errBoom := errors.New("peer exploded")
+	const n = 3
+	results := broadcastWorkers(n, func(i int) peerResult {
+		switch i {
+		case 0:
+			return peerResult{Node: "peer0"}
+		case 1:
+			return peerResult{Node: "peer1", Err: errBoom}
+		default:
+			// Simulate a peer that never answers: block until ctx's
+			// deadline fires, then report the deadline as its error,
+			// exactly as callPeerWithContext does on a real timeout.
+			<-ctx.Done()
+			return peerResult{Node: "peer2", Err: ctx.Err()}
+		}
+	})
+
+	if len(results) != n {
+		t.Fatalf("expected %d results, got %d", n, len(results))
+	}
+	if results[0].Err != nil {
+		t.Errorf("peer0: expected success, got err %v", results[0].Err)
+	}
+	if results[1].Err != errBoom {
+		t.Errorf("peer1: expected %v, got %v", errBoom, results[1].Err)
+	}
+	if results[2].Err != context.DeadlineExceeded {
+		t.Errorf("peer2: expected %v, got %v", context.DeadlineExceeded, results[2].Err)
+	}
+}
+
+// TestBroadcastWorkersAlwaysOneResultPerCall drives more callers than
+// peerBroadcastMaxWorkers through broadcastWorkers, with every other call
+// failing, and verifies the returned slice always has exactly one entry per
+// input index once every worker has been given its turn through the
+// semaphore.
+func TestBroadcastWorkersAlwaysOneResultPerCall(t *testing.T) {
+	const n = peerBroadcastMaxWorkers*2 + 5
+	errOdd := errors.New("odd peer failed")
+
+	results := broadcastWorkers(n, func(i int) peerResult {
+		if i%2 == 0 {
+			return peerResult{Node: "even"}
+		}
+		return peerResult{Node: "odd", Err: errOdd}
+	})
+
+	if len(results) != n {
+		t.Fatalf("expected %d results, got %d", n, len(results))
+	}
+	for i, r := range results {
+		if i%2 == 0 {
+			if r.Err != nil || r.Node != "even" {
+				t.Errorf("result[%d]: expected even success, got %+v", i, r)
+			}
+		} else if r.Err != errOdd || r.Node != "odd" {
+			t.Errorf("result[%d]: expected odd failure, got %+v", i, r)
+		}
+	}
+}